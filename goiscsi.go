@@ -0,0 +1,69 @@
+package goiscsi
+
+import (
+	"context"
+	"log"
+	"os"
+)
+
+// ISCSITarget describes an iSCSI target, either as discovered via
+// sendtargets discovery or as supplied by a caller for login/logout.
+type ISCSITarget struct {
+	Portal   string
+	GroupTag string
+	Target   string
+	// IPv6 is true if Portal is a bracketed IPv6 address, e.g. "[fe80::1]:3260".
+	IPv6 bool
+	// CHAP carries the authentication secrets to use when discovering or
+	// logging into this target. It may be nil, in which case no CHAP
+	// authentication is configured.
+	CHAP *CHAPCredentials
+	// Iface binds login/logout to a specific iface created via CreateIface,
+	// e.g. to pin a session to a particular NIC/VLAN or HBA. Empty uses the
+	// "default" software iface.
+	Iface string
+}
+
+// ISCSIinterface is the common set of methods implemented by LinuxISCSI and
+// MockISCSI for interacting with the iSCSI initiator.
+type ISCSIinterface interface {
+	DiscoverTargets(address string, login bool) ([]ISCSITarget, error)
+	GetInitiators(filename string) ([]string, error)
+	PerformLogin(target ISCSITarget) error
+	PerformLogout(target ISCSITarget) error
+	PerformRescan() error
+}
+
+// ContextISCSIinterface extends ISCSIinterface with context-aware login and
+// logout, so a caller like Connector that may hang against an unreachable
+// portal can be cancelled via ctx. LinuxISCSI and MockISCSI both implement
+// it.
+type ContextISCSIinterface interface {
+	ISCSIinterface
+	PerformLoginContext(ctx context.Context, target ISCSITarget) error
+	PerformLogoutContext(ctx context.Context, target ISCSITarget) error
+}
+
+// ISCSIType is the base type embedded by LinuxISCSI and MockISCSI.
+type ISCSIType struct {
+	mock    bool
+	options map[string]string
+	logger  Logger
+}
+
+// defaultLogger is used whenever SetLogger hasn't been called.
+var defaultLogger Logger = log.New(os.Stderr, "", log.LstdFlags)
+
+// SetLogger overrides the Logger used to report failures, whether or not
+// they are also returned to the caller. Passing nil restores the default, which
+// logs to stderr via the standard log package.
+func (t *ISCSIType) SetLogger(l Logger) {
+	t.logger = l
+}
+
+func (t *ISCSIType) log() Logger {
+	if t.logger == nil {
+		return defaultLogger
+	}
+	return t.logger
+}
@@ -0,0 +1,102 @@
+package goiscsi
+
+// CHAPCredentials holds the secrets used to authenticate an iSCSI discovery
+// session and/or a normal login session via CHAP. The discovery fields
+// configure `discovery.sendtargets.auth.*`, the session fields configure
+// `node.session.auth.*`. The "In" variants hold the initiator's own secret
+// for mutual (bidirectional) CHAP, where the target authenticates itself
+// back to the initiator, mirroring kubernetes' iscsi plugin's
+// chap_discovery/chap_session options.
+type CHAPCredentials struct {
+	DiscoveryUsername   string
+	DiscoveryPassword   string
+	DiscoveryUsernameIn string
+	DiscoveryPasswordIn string
+
+	SessionUsername   string
+	SessionPassword   string
+	SessionUsernameIn string
+	SessionPasswordIn string
+}
+
+// HasDiscoveryCHAP returns true if discovery-phase CHAP credentials are set.
+func (c *CHAPCredentials) HasDiscoveryCHAP() bool {
+	return c != nil && c.DiscoveryUsername != "" && c.DiscoveryPassword != ""
+}
+
+// HasSessionCHAP returns true if session-phase CHAP credentials are set.
+func (c *CHAPCredentials) HasSessionCHAP() bool {
+	return c != nil && c.SessionUsername != "" && c.SessionPassword != ""
+}
+
+// discoveryUpdateArgs returns the `iscsiadm -m discoverydb ... -o update`
+// invocations needed to program discovery-phase CHAP before running
+// discovery against portal.
+func (c *CHAPCredentials) discoveryUpdateArgs(portal string) [][]string {
+	if !c.HasDiscoveryCHAP() {
+		return nil
+	}
+	args := [][]string{
+		discoverydbUpdateArgs(portal, "discovery.sendtargets.auth.authmethod", "CHAP"),
+		discoverydbUpdateArgs(portal, "discovery.sendtargets.auth.username", c.DiscoveryUsername),
+		discoverydbUpdateArgs(portal, "discovery.sendtargets.auth.password", c.DiscoveryPassword),
+	}
+	if c.DiscoveryUsernameIn != "" && c.DiscoveryPasswordIn != "" {
+		args = append(args,
+			discoverydbUpdateArgs(portal, "discovery.sendtargets.auth.username_in", c.DiscoveryUsernameIn),
+			discoverydbUpdateArgs(portal, "discovery.sendtargets.auth.password_in", c.DiscoveryPasswordIn),
+		)
+	}
+	return args
+}
+
+// sessionUpdateArgs returns the `iscsiadm -m node ... --op update`
+// invocations needed to program session-phase CHAP before logging into iqn
+// at portal.
+func (c *CHAPCredentials) sessionUpdateArgs(iqn, portal string) [][]string {
+	if !c.HasSessionCHAP() {
+		return nil
+	}
+	args := [][]string{
+		nodeUpdateArgs(iqn, portal, "node.session.auth.authmethod", "CHAP"),
+		nodeUpdateArgs(iqn, portal, "node.session.auth.username", c.SessionUsername),
+		nodeUpdateArgs(iqn, portal, "node.session.auth.password", c.SessionPassword),
+	}
+	if c.SessionUsernameIn != "" && c.SessionPasswordIn != "" {
+		args = append(args,
+			nodeUpdateArgs(iqn, portal, "node.session.auth.username_in", c.SessionUsernameIn),
+			nodeUpdateArgs(iqn, portal, "node.session.auth.password_in", c.SessionPasswordIn),
+		)
+	}
+	return args
+}
+
+func discoverydbUpdateArgs(portal, name, value string) []string {
+	return []string{"iscsiadm", "-m", "discoverydb", "-t", "sendtargets", "-p", portal, "-o", "update", "-n", name, "-v", value}
+}
+
+// discoverydbNewArgs returns the `iscsiadm -m discoverydb ... -o new`
+// invocation that creates the discoverydb record for portal, required
+// before any `-o update` call against a portal iscsiadm hasn't seen yet.
+func discoverydbNewArgs(portal, iface string) []string {
+	args := []string{"iscsiadm", "-m", "discoverydb", "-t", "sendtargets", "-p", portal, "-o", "new"}
+	if iface != "" {
+		args = append(args, "-I", iface)
+	}
+	return args
+}
+
+// discoverydbDiscoverArgs returns the `iscsiadm -m discoverydb ... --discover`
+// invocation that actually performs discovery against portal, consulting
+// whatever discoverydb auth fields were programmed via discoverydbUpdateArgs.
+func discoverydbDiscoverArgs(portal, iface string) []string {
+	args := []string{"iscsiadm", "-m", "discoverydb", "-t", "sendtargets", "-p", portal, "--discover"}
+	if iface != "" {
+		args = append(args, "-I", iface)
+	}
+	return args
+}
+
+func nodeUpdateArgs(iqn, portal, name, value string) []string {
+	return []string{"iscsiadm", "-m", "node", "-T", iqn, "-p", portal, "--op", "update", "-n", name, "-v", value}
+}
@@ -0,0 +1,156 @@
+package goiscsi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCHAPCredentials_HasDiscoveryCHAP(t *testing.T) {
+	tests := []struct {
+		name string
+		chap *CHAPCredentials
+		want bool
+	}{
+		{name: "nil", chap: nil, want: false},
+		{name: "empty", chap: &CHAPCredentials{}, want: false},
+		{name: "username only", chap: &CHAPCredentials{DiscoveryUsername: "user"}, want: false},
+		{
+			name: "complete",
+			chap: &CHAPCredentials{DiscoveryUsername: "user", DiscoveryPassword: "pass"},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.chap.HasDiscoveryCHAP(); got != tt.want {
+				t.Errorf("HasDiscoveryCHAP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCHAPCredentials_HasSessionCHAP(t *testing.T) {
+	tests := []struct {
+		name string
+		chap *CHAPCredentials
+		want bool
+	}{
+		{name: "nil", chap: nil, want: false},
+		{name: "password only", chap: &CHAPCredentials{SessionPassword: "pass"}, want: false},
+		{
+			name: "complete",
+			chap: &CHAPCredentials{SessionUsername: "user", SessionPassword: "pass"},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.chap.HasSessionCHAP(); got != tt.want {
+				t.Errorf("HasSessionCHAP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMockISCSI_DiscoverTargetsWithCHAP_OneWay(t *testing.T) {
+	iscsi := NewMockISCSI(nil)
+	chap := &CHAPCredentials{DiscoveryUsername: "duser", DiscoveryPassword: "dpass"}
+
+	targets, err := iscsi.DiscoverTargetsWithCHAP("10.0.0.1", false, chap)
+	if err != nil {
+		t.Fatalf("DiscoverTargetsWithCHAP() error = %v", err)
+	}
+	if len(targets) == 0 {
+		t.Fatalf("expected at least one discovered target")
+	}
+	if targets[0].CHAP != chap {
+		t.Errorf("discovered target CHAP = %v, want %v", targets[0].CHAP, chap)
+	}
+}
+
+func TestMockISCSI_DiscoverTargetsWithCHAP_IncompleteRejected(t *testing.T) {
+	iscsi := NewMockISCSI(nil)
+	chap := &CHAPCredentials{DiscoveryUsername: "duser"} // missing password
+
+	if _, err := iscsi.DiscoverTargetsWithCHAP("10.0.0.1", false, chap); err == nil {
+		t.Fatal("expected an error for incomplete discovery CHAP credentials")
+	}
+}
+
+func TestMockISCSI_PerformLogin_MutualCHAP(t *testing.T) {
+	iscsi := NewMockISCSI(nil)
+	target := ISCSITarget{
+		Target: "iqn.1992-04.com.mock:test",
+		Portal: "10.0.0.1:3260",
+		CHAP: &CHAPCredentials{
+			SessionUsername:   "suser",
+			SessionPassword:   "spass",
+			SessionUsernameIn: "inuser",
+			SessionPasswordIn: "inpass",
+		},
+	}
+
+	if err := iscsi.PerformLogin(target); err != nil {
+		t.Fatalf("PerformLogin() with mutual CHAP error = %v", err)
+	}
+}
+
+func TestMockISCSI_PerformLogin_IncompleteSessionCHAPRejected(t *testing.T) {
+	iscsi := NewMockISCSI(nil)
+	target := ISCSITarget{
+		Target: "iqn.1992-04.com.mock:test",
+		Portal: "10.0.0.1:3260",
+		CHAP:   &CHAPCredentials{SessionUsername: "suser"}, // missing password
+	}
+
+	if err := iscsi.PerformLogin(target); err == nil {
+		t.Fatal("expected an error for incomplete session CHAP credentials")
+	}
+}
+
+func TestDiscoverydbNewArgs(t *testing.T) {
+	want := []string{"iscsiadm", "-m", "discoverydb", "-t", "sendtargets", "-p", "10.0.0.1", "-o", "new"}
+	if got := discoverydbNewArgs("10.0.0.1", ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("discoverydbNewArgs() = %v, want %v", got, want)
+	}
+
+	wantIface := []string{"iscsiadm", "-m", "discoverydb", "-t", "sendtargets", "-p", "10.0.0.1", "-o", "new", "-I", "eth1"}
+	if got := discoverydbNewArgs("10.0.0.1", "eth1"); !reflect.DeepEqual(got, wantIface) {
+		t.Errorf("discoverydbNewArgs() with iface = %v, want %v", got, wantIface)
+	}
+}
+
+func TestDiscoverydbDiscoverArgs(t *testing.T) {
+	want := []string{"iscsiadm", "-m", "discoverydb", "-t", "sendtargets", "-p", "10.0.0.1", "--discover"}
+	if got := discoverydbDiscoverArgs("10.0.0.1", ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("discoverydbDiscoverArgs() = %v, want %v", got, want)
+	}
+
+	wantIface := []string{"iscsiadm", "-m", "discoverydb", "-t", "sendtargets", "-p", "10.0.0.1", "--discover", "-I", "eth1"}
+	if got := discoverydbDiscoverArgs("10.0.0.1", "eth1"); !reflect.DeepEqual(got, wantIface) {
+		t.Errorf("discoverydbDiscoverArgs() with iface = %v, want %v", got, wantIface)
+	}
+}
+
+func TestDiscoverydbUpdateArgs(t *testing.T) {
+	want := []string{"iscsiadm", "-m", "discoverydb", "-t", "sendtargets", "-p", "10.0.0.1", "-o", "update", "-n", "discovery.sendtargets.auth.authmethod", "-v", "CHAP"}
+	if got := discoverydbUpdateArgs("10.0.0.1", "discovery.sendtargets.auth.authmethod", "CHAP"); !reflect.DeepEqual(got, want) {
+		t.Errorf("discoverydbUpdateArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestCHAPCredentials_DiscoveryUpdateArgs_UsesDiscoverydbNamespace(t *testing.T) {
+	chap := &CHAPCredentials{DiscoveryUsername: "duser", DiscoveryPassword: "dpass"}
+
+	args := chap.discoveryUpdateArgs("10.0.0.1")
+	if len(args) == 0 {
+		t.Fatal("expected at least one discoverydb update invocation")
+	}
+	for _, a := range args {
+		if len(a) < 2 || a[0] != "iscsiadm" || a[1] != "-m" || a[2] != "discoverydb" {
+			t.Errorf("discoveryUpdateArgs() invocation = %v, want it to target -m discoverydb", a)
+		}
+	}
+}
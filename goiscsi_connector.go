@@ -0,0 +1,263 @@
+package goiscsi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultStateDir is the default directory Connector uses to persist
+	// per-volume connection records.
+	DefaultStateDir = "/var/lib/goiscsi"
+
+	devDiskByPath      = "/dev/disk/by-path"
+	sysBlock           = "/sys/block"
+	deviceWaitInterval = 100 * time.Millisecond
+)
+
+// ConnectRequest describes an iSCSI volume to connect to, optionally across
+// multiple portals for multipath.
+type ConnectRequest struct {
+	IQN     string
+	Portals []string
+	Lun     int
+	Iface   string
+	CHAP    *CHAPCredentials
+}
+
+// connectionRecord is the persisted record of a successful Connect. It lets
+// Disconnect find every portal a volume was logged into, even when the
+// caller only supplies one of them.
+type connectionRecord struct {
+	IQN     string   `json:"iqn"`
+	Portals []string `json:"portals"`
+	Lun     int      `json:"lun"`
+	Iface   string   `json:"iface,omitempty"`
+	// CHAPUser is the session CHAP username used to connect, if any. It is
+	// a reference only: the password is never persisted. Disconnect does not
+	// read it and does not expose it to callers.
+	CHAPUser string `json:"chapUser,omitempty"`
+}
+
+// chapUserRef returns the session CHAP username configured in chap, or ""
+// if chap is nil or has no session credentials.
+func chapUserRef(chap *CHAPCredentials) string {
+	if !chap.HasSessionCHAP() {
+		return ""
+	}
+	return chap.SessionUsername
+}
+
+// Connector provides a multipath-aware connect/disconnect API layered on
+// top of a ContextISCSIinterface client. Connect logs into every portal supplied
+// for a volume (not just the first), resolves the resulting
+// /dev/disk/by-path devices and, when more than one portal is used, the
+// dm-N multipath device assembled from them. It persists enough state
+// under StateDir for Disconnect to log out of every portal later, even if
+// the caller only supplies one of them at that point -- fixing the common
+// bug where only the primary portal gets logged out and a stale session is
+// left behind.
+type Connector struct {
+	ISCSI    ContextISCSIinterface
+	StateDir string
+
+	// waitForDevice and resolveMultipath are overridable so tests can
+	// simulate device appearance and multipath resolution without a real
+	// initiator or block layer.
+	waitForDevice    func(ctx context.Context, path string) (string, error)
+	resolveMultipath func(devices []string) (string, error)
+}
+
+// NewConnector returns a Connector backed by iscsi, persisting connection
+// records under stateDir (DefaultStateDir if empty).
+func NewConnector(iscsi ContextISCSIinterface, stateDir string) *Connector {
+	if stateDir == "" {
+		stateDir = DefaultStateDir
+	}
+	return &Connector{
+		ISCSI:            iscsi,
+		StateDir:         stateDir,
+		waitForDevice:    waitForDevice,
+		resolveMultipath: resolveMultipathDevice,
+	}
+}
+
+// Connect logs into every portal in req.Portals, waits for the resulting
+// block devices to appear, and returns the device path to use: the dm-N
+// multipath device if more than one portal was supplied and multipathd has
+// assembled one, otherwise the single discovered device. If any portal
+// fails to log in or its device never appears, Connect logs back out of
+// every portal it had already logged into before returning the error.
+func (c *Connector) Connect(ctx context.Context, req ConnectRequest) (string, error) {
+	if len(req.Portals) == 0 {
+		return "", fmt.Errorf("goiscsi: Connect requires at least one portal")
+	}
+
+	loggedIn := make([]string, 0, len(req.Portals))
+	rollback := func() {
+		// ctx may already be done (e.g. a device wait that timed out), so the
+		// logouts run under their own context rather than being skipped.
+		for _, portal := range loggedIn {
+			c.ISCSI.PerformLogoutContext(context.Background(), ISCSITarget{Target: req.IQN, Portal: portal, Iface: req.Iface})
+		}
+	}
+
+	for _, portal := range req.Portals {
+		target := ISCSITarget{Target: req.IQN, Portal: portal, Iface: req.Iface, CHAP: req.CHAP}
+		if err := c.ISCSI.PerformLoginContext(ctx, target); err != nil {
+			rollback()
+			return "", fmt.Errorf("goiscsi: login to %s at %s: %w", req.IQN, portal, err)
+		}
+		loggedIn = append(loggedIn, portal)
+	}
+
+	devices := make([]string, 0, len(req.Portals))
+	for _, portal := range req.Portals {
+		dev, err := c.waitForDevice(ctx, byPathDevice(portal, req.IQN, req.Lun))
+		if err != nil {
+			rollback()
+			return "", fmt.Errorf("goiscsi: waiting for device for %s at %s: %w", req.IQN, portal, err)
+		}
+		devices = append(devices, dev)
+	}
+
+	device := devices[0]
+	if len(devices) > 1 {
+		if dm, err := c.resolveMultipath(devices); err == nil {
+			device = dm
+		}
+	}
+
+	if err := c.persist(req); err != nil {
+		rollback()
+		return "", fmt.Errorf("goiscsi: persisting connection record for %s: %w", req.IQN, err)
+	}
+
+	return device, nil
+}
+
+// Disconnect logs out of every portal previously used to connect to iqn. It
+// prefers the persisted connection record over the supplied portals so
+// that a caller passing only one portal still cleans up every session.
+func (c *Connector) Disconnect(ctx context.Context, iqn string, portals []string) error {
+	var iface string
+	if rec, err := c.load(iqn); err == nil {
+		portals = rec.Portals
+		iface = rec.Iface
+	}
+
+	var firstErr error
+	for _, portal := range portals {
+		target := ISCSITarget{Target: iqn, Portal: portal, Iface: iface}
+		if err := c.ISCSI.PerformLogoutContext(ctx, target); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if err := c.remove(iqn); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	return firstErr
+}
+
+func (c *Connector) recordPath(iqn string) string {
+	return filepath.Join(c.StateDir, sanitizeIQN(iqn)+".json")
+}
+
+func (c *Connector) persist(req ConnectRequest) error {
+	if err := os.MkdirAll(c.StateDir, 0750); err != nil {
+		return err
+	}
+	rec := connectionRecord{IQN: req.IQN, Portals: req.Portals, Lun: req.Lun, Iface: req.Iface, CHAPUser: chapUserRef(req.CHAP)}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.recordPath(req.IQN), data, 0600)
+}
+
+func (c *Connector) load(iqn string) (connectionRecord, error) {
+	var rec connectionRecord
+	data, err := os.ReadFile(c.recordPath(iqn))
+	if err != nil {
+		return rec, err
+	}
+	err = json.Unmarshal(data, &rec)
+	return rec, err
+}
+
+func (c *Connector) remove(iqn string) error {
+	err := os.Remove(c.recordPath(iqn))
+	if err != nil && os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// sanitizeIQN makes iqn safe to use as a filename.
+func sanitizeIQN(iqn string) string {
+	return strings.NewReplacer(":", "_", "/", "_").Replace(iqn)
+}
+
+// byPathDevice returns the udev by-path device a successful login to iqn at
+// portal for lun is expected to create.
+func byPathDevice(portal, iqn string, lun int) string {
+	return filepath.Join(devDiskByPath, fmt.Sprintf("ip-%s-iscsi-%s-lun-%d", portal, iqn, lun))
+}
+
+// waitForDevice polls for path to appear, returning ctx.Err() if ctx is
+// done first.
+func waitForDevice(ctx context.Context, path string) (string, error) {
+	ticker := time.NewTicker(deviceWaitInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// resolveMultipathDevice walks /sys/block/dm-*/slaves looking for a
+// multipath device assembled from slaveDevices, returning its /dev path.
+func resolveMultipathDevice(slaveDevices []string) (string, error) {
+	slaveNames := make(map[string]bool, len(slaveDevices))
+	for _, dev := range slaveDevices {
+		resolved, err := filepath.EvalSymlinks(dev)
+		if err != nil {
+			continue
+		}
+		slaveNames[filepath.Base(resolved)] = true
+	}
+
+	entries, err := os.ReadDir(sysBlock)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "dm-") {
+			continue
+		}
+		slaves, err := os.ReadDir(filepath.Join(sysBlock, entry.Name(), "slaves"))
+		if err != nil {
+			continue
+		}
+		for _, slave := range slaves {
+			if slaveNames[slave.Name()] {
+				return filepath.Join("/dev", entry.Name()), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no multipath device found for slaves %v", slaveDevices)
+}
@@ -0,0 +1,164 @@
+package goiscsi
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeConnISCSI is a minimal ContextISCSIinterface double that lets tests
+// control exactly which portal's login fails, independent of the global
+// GOISCSIMock induced-error flags.
+type fakeConnISCSI struct {
+	failLoginPortal string
+	loggedIn        []string
+	loggedOut       []string
+	logoutIfaces    []string
+}
+
+func (f *fakeConnISCSI) DiscoverTargets(string, bool) ([]ISCSITarget, error) { return nil, nil }
+func (f *fakeConnISCSI) GetInitiators(string) ([]string, error)              { return nil, nil }
+func (f *fakeConnISCSI) PerformRescan() error                                { return nil }
+
+func (f *fakeConnISCSI) PerformLogin(target ISCSITarget) error {
+	return f.PerformLoginContext(context.Background(), target)
+}
+
+func (f *fakeConnISCSI) PerformLogout(target ISCSITarget) error {
+	return f.PerformLogoutContext(context.Background(), target)
+}
+
+func (f *fakeConnISCSI) PerformLoginContext(_ context.Context, target ISCSITarget) error {
+	if target.Portal == f.failLoginPortal {
+		return errors.New("induced login failure")
+	}
+	f.loggedIn = append(f.loggedIn, target.Portal)
+	return nil
+}
+
+func (f *fakeConnISCSI) PerformLogoutContext(_ context.Context, target ISCSITarget) error {
+	f.loggedOut = append(f.loggedOut, target.Portal)
+	f.logoutIfaces = append(f.logoutIfaces, target.Iface)
+	return nil
+}
+
+func TestConnector_Connect_SinglePortal(t *testing.T) {
+	fake := &fakeConnISCSI{}
+	c := NewConnector(fake, t.TempDir())
+	c.waitForDevice = func(_ context.Context, path string) (string, error) { return path, nil }
+
+	device, err := c.Connect(context.Background(), ConnectRequest{
+		IQN:     "iqn.1992-04.com.test:vol0",
+		Portals: []string{"10.0.0.1:3260"},
+		Lun:     0,
+	})
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	want := byPathDevice("10.0.0.1:3260", "iqn.1992-04.com.test:vol0", 0)
+	if device != want {
+		t.Errorf("Connect() device = %q, want %q", device, want)
+	}
+	if !reflect.DeepEqual(fake.loggedIn, []string{"10.0.0.1:3260"}) {
+		t.Errorf("loggedIn = %v, want [10.0.0.1:3260]", fake.loggedIn)
+	}
+}
+
+func TestConnector_Connect_MultipathResolution(t *testing.T) {
+	fake := &fakeConnISCSI{}
+	c := NewConnector(fake, t.TempDir())
+	c.waitForDevice = func(_ context.Context, path string) (string, error) { return path, nil }
+	c.resolveMultipath = func(devices []string) (string, error) {
+		if len(devices) != 2 {
+			t.Fatalf("resolveMultipath called with %d devices, want 2", len(devices))
+		}
+		return "/dev/dm-0", nil
+	}
+
+	device, err := c.Connect(context.Background(), ConnectRequest{
+		IQN:     "iqn.1992-04.com.test:vol0",
+		Portals: []string{"10.0.0.1:3260", "10.0.0.2:3260"},
+		Lun:     0,
+	})
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if device != "/dev/dm-0" {
+		t.Errorf("Connect() device = %q, want /dev/dm-0", device)
+	}
+}
+
+func TestConnector_Connect_PartialLoginRollback(t *testing.T) {
+	fake := &fakeConnISCSI{failLoginPortal: "10.0.0.2:3260"}
+	c := NewConnector(fake, t.TempDir())
+	c.waitForDevice = func(_ context.Context, path string) (string, error) { return path, nil }
+
+	_, err := c.Connect(context.Background(), ConnectRequest{
+		IQN:     "iqn.1992-04.com.test:vol0",
+		Portals: []string{"10.0.0.1:3260", "10.0.0.2:3260", "10.0.0.3:3260"},
+		Lun:     0,
+	})
+	if err == nil {
+		t.Fatal("expected Connect() to fail when a portal login fails")
+	}
+	if !reflect.DeepEqual(fake.loggedIn, []string{"10.0.0.1:3260"}) {
+		t.Errorf("loggedIn = %v, want [10.0.0.1:3260]", fake.loggedIn)
+	}
+	if !reflect.DeepEqual(fake.loggedOut, []string{"10.0.0.1:3260"}) {
+		t.Errorf("loggedOut = %v, want [10.0.0.1:3260] (rollback of the successful login only)", fake.loggedOut)
+	}
+}
+
+func TestConnector_Connect_DeviceTimeoutRollsBack(t *testing.T) {
+	fake := &fakeConnISCSI{}
+	c := NewConnector(fake, t.TempDir())
+	// leave waitForDevice as the real implementation: it polls a path under
+	// /dev/disk/by-path that will never appear, so ctx should time out.
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := c.Connect(ctx, ConnectRequest{
+		IQN:     "iqn.1992-04.com.test:vol0",
+		Portals: []string{"10.0.0.1:3260"},
+		Lun:     0,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Connect() error = %v, want context.DeadlineExceeded", err)
+	}
+	if !reflect.DeepEqual(fake.loggedOut, []string{"10.0.0.1:3260"}) {
+		t.Errorf("loggedOut = %v, want [10.0.0.1:3260] (rollback after device never appeared)", fake.loggedOut)
+	}
+}
+
+func TestConnector_Connect_Disconnect_UsesPersistedPortalsAndIface(t *testing.T) {
+	fake := &fakeConnISCSI{}
+	c := NewConnector(fake, t.TempDir())
+	c.waitForDevice = func(_ context.Context, path string) (string, error) { return path, nil }
+
+	req := ConnectRequest{
+		IQN:     "iqn.1992-04.com.test:vol0",
+		Portals: []string{"10.0.0.1:3260", "10.0.0.2:3260"},
+		Lun:     0,
+		Iface:   "eth1",
+	}
+	if _, err := c.Connect(context.Background(), req); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	// Disconnect is called with only one of the two portals, but should
+	// still log out of both, using the persisted record.
+	if err := c.Disconnect(context.Background(), req.IQN, []string{"10.0.0.1:3260"}); err != nil {
+		t.Fatalf("Disconnect() error = %v", err)
+	}
+
+	want := []string{"10.0.0.1:3260", "10.0.0.2:3260"}
+	if !reflect.DeepEqual(fake.loggedOut, want) {
+		t.Errorf("loggedOut = %v, want %v", fake.loggedOut, want)
+	}
+	if wantIfaces := []string{"eth1", "eth1"}; !reflect.DeepEqual(fake.logoutIfaces, wantIfaces) {
+		t.Errorf("logoutIfaces = %v, want %v", fake.logoutIfaces, wantIfaces)
+	}
+}
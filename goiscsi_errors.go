@@ -0,0 +1,52 @@
+package goiscsi
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrSessionExists is returned when iscsiadm reports that a login
+	// session already exists (exit code 15). Callers that only care whether
+	// a session is now present can treat this the same as success.
+	ErrSessionExists = errors.New("iscsiadm: session already exists")
+	// ErrNoObjectsFound is returned when iscsiadm reports that no matching
+	// records were found (exit code 21), e.g. logging out of a target with
+	// no active session.
+	ErrNoObjectsFound = errors.New("iscsiadm: no objects found")
+)
+
+// ISCSIError describes a failed iscsiadm invocation, carrying enough detail
+// for a caller to branch on the failure (via errors.Is against a sentinel
+// like ErrSessionExists) or surface the underlying stderr and exit code to
+// a user.
+type ISCSIError struct {
+	Op       string // e.g. "discovery", "login", "logout", "rescan"
+	IQN      string
+	Portal   string
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+func (e *ISCSIError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("iscsiadm %s failed (exit %d): %s", e.Op, e.ExitCode, e.Stderr)
+	}
+	return fmt.Sprintf("iscsiadm %s failed (exit %d): %v", e.Op, e.ExitCode, e.Err)
+}
+
+// Unwrap lets callers use errors.Is/errors.As against the sentinel or
+// underlying error wrapped by an ISCSIError.
+func (e *ISCSIError) Unwrap() error {
+	return e.Err
+}
+
+// Logger is the minimal logging interface LinuxISCSI uses to report every
+// failed iscsiadm invocation and initiator file read, including failures it
+// also returns and those it ignores (e.g. logins during discovery with
+// login=true). It is satisfied by *log.Logger; pass a custom implementation
+// to SetLogger to route output through log/slog or another logging system.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
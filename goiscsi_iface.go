@@ -0,0 +1,145 @@
+package goiscsi
+
+import (
+	"context"
+	"strings"
+)
+
+// IfaceParams configures an iscsiadm iface binding. Any field left empty is
+// not programmed, leaving iscsiadm's default for that setting in place.
+type IfaceParams struct {
+	// NetIfaceName binds the iface to a specific NIC, e.g. "eth1" -- the
+	// usual way to pin a session to a particular VLAN or storage network.
+	NetIfaceName string
+	// IPAddress binds the iface to a specific local IP address.
+	IPAddress string
+	// HWAddress binds the iface to a specific HBA/NIC MAC address.
+	HWAddress string
+	// InitiatorName overrides the initiator name used by this iface alone,
+	// instead of the host-wide /etc/iscsi/initiatorname.iscsi.
+	InitiatorName string
+}
+
+// Iface is one row of `iscsiadm -m iface` output.
+type Iface struct {
+	Name          string
+	Transport     string
+	HWAddress     string
+	IPAddress     string
+	NetIfaceName  string
+	InitiatorName string
+}
+
+// ifaceEmpty is how iscsiadm renders an unset iface field.
+const ifaceEmpty = "<empty>"
+
+// CreateIface creates a new iscsiadm iface named name and programs params
+// onto it.
+func (iscsi *LinuxISCSI) CreateIface(name string, params IfaceParams) error {
+	return iscsi.CreateIfaceContext(context.Background(), name, params)
+}
+
+// CreateIfaceContext is like CreateIface but accepts a context.Context.
+func (iscsi *LinuxISCSI) CreateIfaceContext(ctx context.Context, name string, params IfaceParams) error {
+	if _, err := iscsi.runISCSIAdm(ctx, "iface-new", "", "", []string{"iscsiadm", "-m", "iface", "-I", name, "--op=new"}); err != nil {
+		return err
+	}
+
+	updates := map[string]string{
+		"iface.net_ifacename": params.NetIfaceName,
+		"iface.ipaddress":     params.IPAddress,
+		"iface.hwaddress":     params.HWAddress,
+		"iface.initiatorname": params.InitiatorName,
+	}
+	for param, value := range updates {
+		if value == "" {
+			continue
+		}
+		if err := iscsi.updateIfaceParam(ctx, name, param, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteIface deletes the iscsiadm iface named name.
+func (iscsi *LinuxISCSI) DeleteIface(name string) error {
+	return iscsi.DeleteIfaceContext(context.Background(), name)
+}
+
+// DeleteIfaceContext is like DeleteIface but accepts a context.Context.
+func (iscsi *LinuxISCSI) DeleteIfaceContext(ctx context.Context, name string) error {
+	_, err := iscsi.runISCSIAdm(ctx, "iface-delete", "", "", []string{"iscsiadm", "-m", "iface", "-I", name, "--op=delete"})
+	return err
+}
+
+// ListIfaces returns the ifaces known to the local iscsiadm iface database.
+func (iscsi *LinuxISCSI) ListIfaces() ([]Iface, error) {
+	return iscsi.ListIfacesContext(context.Background())
+}
+
+// ListIfacesContext is like ListIfaces but accepts a context.Context.
+func (iscsi *LinuxISCSI) ListIfacesContext(ctx context.Context) ([]Iface, error) {
+	out, err := iscsi.runISCSIAdm(ctx, "iface-list", "", "", []string{"iscsiadm", "-m", "iface"})
+	if err != nil {
+		return nil, err
+	}
+	return parseIfaceListOutput(string(out)), nil
+}
+
+// UpdateIfaceInitiatorName sets the initiator name used by iface alone,
+// cloning the per-host /etc/iscsi/initiatorname.iscsi semantics down to a
+// single iface so it can authenticate with its own identity.
+func (iscsi *LinuxISCSI) UpdateIfaceInitiatorName(iface, initiatorName string) error {
+	return iscsi.UpdateIfaceInitiatorNameContext(context.Background(), iface, initiatorName)
+}
+
+// UpdateIfaceInitiatorNameContext is like UpdateIfaceInitiatorName but
+// accepts a context.Context.
+func (iscsi *LinuxISCSI) UpdateIfaceInitiatorNameContext(ctx context.Context, iface, initiatorName string) error {
+	return iscsi.updateIfaceParam(ctx, iface, "iface.initiatorname", initiatorName)
+}
+
+func (iscsi *LinuxISCSI) updateIfaceParam(ctx context.Context, iface, name, value string) error {
+	_, err := iscsi.runISCSIAdm(ctx, "iface-update", "", "",
+		[]string{"iscsiadm", "-m", "iface", "-I", iface, "--op=update", "-n", name, "-v", value})
+	return err
+}
+
+// parseIfaceListOutput parses the output of `iscsiadm -m iface`, where each
+// line is "<name> <transport>,<hwaddress>,<ipaddress>,<net_ifacename>,<initiatorname>".
+func parseIfaceListOutput(out string) []Iface {
+	ifaces := make([]Iface, 0)
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		parts := strings.Split(fields[1], ",")
+		if len(parts) != 5 {
+			continue
+		}
+
+		ifaces = append(ifaces, Iface{
+			Name:          fields[0],
+			Transport:     ifaceValue(parts[0]),
+			HWAddress:     ifaceValue(parts[1]),
+			IPAddress:     ifaceValue(parts[2]),
+			NetIfaceName:  ifaceValue(parts[3]),
+			InitiatorName: ifaceValue(parts[4]),
+		})
+	}
+
+	return ifaces
+}
+
+// ifaceValue turns iscsiadm's "<empty>" placeholder into an empty string.
+func ifaceValue(s string) string {
+	if s == ifaceEmpty {
+		return ""
+	}
+	return s
+}
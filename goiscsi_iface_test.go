@@ -0,0 +1,104 @@
+package goiscsi
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseIfaceListOutput(t *testing.T) {
+	out := "default tcp,<empty>,<empty>,<empty>,<empty>\n" +
+		"eth1 tcp,aa:bb:cc:dd:ee:ff,10.0.0.5,eth1,iqn.1994-05.com.redhat:client\n" +
+		"\n" +
+		"malformed line with too few commas\n"
+
+	got := parseIfaceListOutput(out)
+	want := []Iface{
+		{Name: "default", Transport: "tcp"},
+		{
+			Name:          "eth1",
+			Transport:     "tcp",
+			HWAddress:     "aa:bb:cc:dd:ee:ff",
+			IPAddress:     "10.0.0.5",
+			NetIfaceName:  "eth1",
+			InitiatorName: "iqn.1994-05.com.redhat:client",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIfaceListOutput() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseIfaceListOutput_Empty(t *testing.T) {
+	if got := parseIfaceListOutput(""); len(got) != 0 {
+		t.Errorf("parseIfaceListOutput(\"\") = %+v, want empty", got)
+	}
+}
+
+func TestMockISCSI_CreateDeleteListIfaces(t *testing.T) {
+	iscsi := NewMockISCSI(nil)
+
+	if err := iscsi.CreateIface("eth1", IfaceParams{
+		NetIfaceName:  "eth1",
+		IPAddress:     "10.0.0.5",
+		HWAddress:     "aa:bb:cc:dd:ee:ff",
+		InitiatorName: "iqn.1994-05.com.redhat:client",
+	}); err != nil {
+		t.Fatalf("CreateIface() error = %v", err)
+	}
+	if err := iscsi.CreateIface("eth2", IfaceParams{NetIfaceName: "eth2"}); err != nil {
+		t.Fatalf("CreateIface() error = %v", err)
+	}
+
+	ifaces, err := iscsi.ListIfaces()
+	if err != nil {
+		t.Fatalf("ListIfaces() error = %v", err)
+	}
+	sort.Slice(ifaces, func(i, j int) bool { return ifaces[i].Name < ifaces[j].Name })
+
+	want := []Iface{
+		{Name: "eth1", Transport: "tcp", HWAddress: "aa:bb:cc:dd:ee:ff", IPAddress: "10.0.0.5", NetIfaceName: "eth1", InitiatorName: "iqn.1994-05.com.redhat:client"},
+		{Name: "eth2", Transport: "tcp", NetIfaceName: "eth2"},
+	}
+	if !reflect.DeepEqual(ifaces, want) {
+		t.Errorf("ListIfaces() = %+v, want %+v", ifaces, want)
+	}
+
+	if err := iscsi.UpdateIfaceInitiatorName("eth2", "iqn.1994-05.com.redhat:other"); err != nil {
+		t.Fatalf("UpdateIfaceInitiatorName() error = %v", err)
+	}
+	if err := iscsi.UpdateIfaceInitiatorName("does-not-exist", "iqn.foo"); err == nil {
+		t.Error("expected an error updating an unknown iface")
+	}
+
+	if err := iscsi.DeleteIface("eth1"); err != nil {
+		t.Fatalf("DeleteIface() error = %v", err)
+	}
+	ifaces, err = iscsi.ListIfaces()
+	if err != nil {
+		t.Fatalf("ListIfaces() error = %v", err)
+	}
+	if len(ifaces) != 1 || ifaces[0].Name != "eth2" {
+		t.Errorf("ListIfaces() after delete = %+v, want only eth2", ifaces)
+	}
+}
+
+func TestMockISCSI_PerformLogin_RejectsUnknownIface(t *testing.T) {
+	iscsi := NewMockISCSI(nil)
+	target := ISCSITarget{
+		Target: "iqn.1992-04.com.mock:test",
+		Portal: "10.0.0.1:3260",
+		Iface:  "eth1",
+	}
+
+	if err := iscsi.PerformLogin(target); err == nil {
+		t.Fatal("expected an error logging in against an iface that was never created")
+	}
+
+	if err := iscsi.CreateIface("eth1", IfaceParams{NetIfaceName: "eth1"}); err != nil {
+		t.Fatalf("CreateIface() error = %v", err)
+	}
+	if err := iscsi.PerformLogin(target); err != nil {
+		t.Errorf("PerformLogin() after CreateIface error = %v", err)
+	}
+}
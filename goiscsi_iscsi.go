@@ -1,9 +1,12 @@
 package goiscsi
 
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"errors"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 	"syscall"
 )
@@ -15,6 +18,10 @@ const (
 	DefaultInitiatorNameFile = "/etc/iscsi/initiatorname.iscsi"
 )
 
+// initiatorNameRegex matches an "InitiatorName=<iqn>" directive, tolerating
+// leading/trailing whitespace around the name and the "=".
+var initiatorNameRegex = regexp.MustCompile(`^\s*InitiatorName\s*=\s*(\S+)`)
+
 // LinuxISCSI provides many iSCSI-specific functions.
 type LinuxISCSI struct {
 	ISCSIType
@@ -41,6 +48,59 @@ func (iscsi *LinuxISCSI) getChrootDirectory() string {
 	return s
 }
 
+// runCHAPUpdatesContext runs each of the given iscsiadm invocations in turn,
+// stopping at the first failure.
+func (iscsi *LinuxISCSI) runCHAPUpdatesContext(ctx context.Context, updates [][]string) error {
+	for _, update := range updates {
+		if _, err := iscsi.runISCSIAdm(ctx, "chap-update", "", "", update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runISCSIAdm runs an iscsiadm invocation under ctx, so callers can cancel
+// a hung command against an unreachable portal. On failure it returns an
+// *ISCSIError carrying iqn, portal, the exit code, and stderr; iqn and
+// portal may be left blank when not applicable to op.
+func (iscsi *LinuxISCSI) runISCSIAdm(ctx context.Context, op, iqn, portal string, args []string) ([]byte, error) {
+	exe := iscsi.buildISCSICommand(args)
+	cmd := exec.CommandContext(ctx, exe[0], exe[1:]...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err == nil {
+		return out, nil
+	}
+
+	exitCode := -1
+	wrapped := err
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			exitCode = status.ExitStatus()
+		}
+		switch exitCode {
+		case 15:
+			wrapped = ErrSessionExists
+		case 21:
+			wrapped = ErrNoObjectsFound
+		}
+	}
+
+	iscsiErr := &ISCSIError{
+		Op:       op,
+		IQN:      iqn,
+		Portal:   portal,
+		ExitCode: exitCode,
+		Stderr:   strings.TrimSpace(stderr.String()),
+		Err:      wrapped,
+	}
+	iscsi.log().Printf("%v", iscsiErr)
+	return out, iscsiErr
+}
+
 func (iscsi *LinuxISCSI) buildISCSICommand(cmd []string) []string {
 	if iscsi.getChrootDirectory() == "/" {
 		return cmd
@@ -52,20 +112,74 @@ func (iscsi *LinuxISCSI) buildISCSICommand(cmd []string) []string {
 	return command
 }
 
+// DiscoveryOptions configures optional discovery behavior: which CHAP
+// secrets to program beforehand, and which iface to bind discovery to (for
+// hosts with multiple NICs or HBAs on different storage networks).
+type DiscoveryOptions struct {
+	CHAP  *CHAPCredentials
+	Iface string
+}
+
 // DiscoverTargets runs an iSCSI discovery and returns a list of targets.
 func (iscsi *LinuxISCSI) DiscoverTargets(address string, login bool) ([]ISCSITarget, error) {
-	return iscsi.discoverTargets(address, login)
+	return iscsi.discoverTargetsWithOptions(context.Background(), address, login, DiscoveryOptions{})
+}
+
+// DiscoverTargetsContext is like DiscoverTargets but accepts a
+// context.Context so callers can cancel a discovery that hangs against an
+// unreachable portal.
+func (iscsi *LinuxISCSI) DiscoverTargetsContext(ctx context.Context, address string, login bool) ([]ISCSITarget, error) {
+	return iscsi.discoverTargetsWithOptions(ctx, address, login, DiscoveryOptions{})
+}
+
+// DiscoverTargetsWithCHAP runs an iSCSI discovery against address, first
+// programming the discovery-phase CHAP secrets in chap (if any), and
+// returns the list of discovered targets.
+func (iscsi *LinuxISCSI) DiscoverTargetsWithCHAP(address string, login bool, chap *CHAPCredentials) ([]ISCSITarget, error) {
+	return iscsi.discoverTargetsWithOptions(context.Background(), address, login, DiscoveryOptions{CHAP: chap})
+}
+
+// DiscoverTargetsWithCHAPContext combines DiscoverTargetsWithCHAP and
+// DiscoverTargetsContext.
+func (iscsi *LinuxISCSI) DiscoverTargetsWithCHAPContext(ctx context.Context, address string, login bool, chap *CHAPCredentials) ([]ISCSITarget, error) {
+	return iscsi.discoverTargetsWithOptions(ctx, address, login, DiscoveryOptions{CHAP: chap})
+}
+
+// DiscoverTargetsWithOptions runs an iSCSI discovery against address,
+// applying the given DiscoveryOptions.
+func (iscsi *LinuxISCSI) DiscoverTargetsWithOptions(address string, login bool, opts DiscoveryOptions) ([]ISCSITarget, error) {
+	return iscsi.discoverTargetsWithOptions(context.Background(), address, login, opts)
+}
+
+// DiscoverTargetsWithOptionsContext combines DiscoverTargetsWithOptions and
+// DiscoverTargetsContext.
+func (iscsi *LinuxISCSI) DiscoverTargetsWithOptionsContext(ctx context.Context, address string, login bool, opts DiscoveryOptions) ([]ISCSITarget, error) {
+	return iscsi.discoverTargetsWithOptions(ctx, address, login, opts)
 }
 
 func (iscsi *LinuxISCSI) discoverTargets(address string, login bool) ([]ISCSITarget, error) {
-	// iSCSI discovery is done via the iscsiadm cli
-	// iscsiadm -m discovery -t st --portal <target>
-	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "discovery", "-t", "st", "--portal", address})
-	cmd := exec.Command(exe[0], exe[1:]...)
+	return iscsi.discoverTargetsWithOptions(context.Background(), address, login, DiscoveryOptions{})
+}
 
-	out, err := cmd.Output()
+func (iscsi *LinuxISCSI) discoverTargetsWithOptions(ctx context.Context, address string, login bool, opts DiscoveryOptions) ([]ISCSITarget, error) {
+	// Discovery always goes through the discoverydb, not `-m discovery -t
+	// st`: that's the only command namespace whose auth.* fields the
+	// --discover call below actually consults, mirroring kubernetes' iscsi
+	// plugin. -o new creates the discoverydb record for address so the -o
+	// update calls below (and any future ones) have something to update.
+	if _, err := iscsi.runISCSIAdm(ctx, "discoverydb-new", "", address, discoverydbNewArgs(address, opts.Iface)); err != nil {
+		return []ISCSITarget{}, err
+	}
+
+	if opts.CHAP.HasDiscoveryCHAP() {
+		if err := iscsi.runCHAPUpdatesContext(ctx, opts.CHAP.discoveryUpdateArgs(address)); err != nil {
+			return []ISCSITarget{}, err
+		}
+	}
+
+	// iscsiadm -m discoverydb -t sendtargets -p <target> [-I <iface>] --discover
+	out, err := iscsi.runISCSIAdm(ctx, "discovery", "", address, discoverydbDiscoverArgs(address, opts.Iface))
 	if err != nil {
-		fmt.Printf("Error discovering %s: %v", address, err)
 		return []ISCSITarget{}, err
 	}
 
@@ -74,36 +188,71 @@ func (iscsi *LinuxISCSI) discoverTargets(address string, login bool) ([]ISCSITar
 	for _, line := range strings.Split(string(out), "\n") {
 		// one line of the output should look like:
 		// 10.247.73.130:3260,0 iqn.1992-04.com.emc:600009700bcbb70e3287017400000001
+		// [fe80::1]:3260,1 iqn.1992-04.com.emc:600009700bcbb70e3287017400000001
 		// Portal,GroupTag Target
-		tokens := strings.Split(line, " ")
-		// make sure we got two tokens
-		if len(tokens) == 2 {
-			addrtag := strings.Split(line, " ")[0]
-			tgt := strings.Split(line, " ")[1]
-			targets = append(targets,
-				ISCSITarget{
-					Portal:   strings.Split(addrtag, ",")[0],
-					GroupTag: strings.Split(addrtag, ",")[1],
-					Target:   tgt,
-				})
+		target, ok := parseDiscoveryLine(line)
+		if !ok {
+			continue
 		}
+		target.CHAP = opts.CHAP
+		target.Iface = opts.Iface
+		targets = append(targets, target)
 	}
 	// log into the target if asked
 	if login {
 		for _, t := range targets {
-			iscsi.PerformLogin(t)
+			iscsi.performLoginContext(ctx, t)
 		}
 	}
 
 	return targets, nil
 }
 
+// parseDiscoveryLine parses one line of `iscsiadm -m discovery -t st`
+// output into an ISCSITarget. It tolerates runs of whitespace between the
+// portal and target, and IPv6 portals such as "[fe80::1]:3260,1", whose
+// address itself contains colons.
+func parseDiscoveryLine(line string) (ISCSITarget, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return ISCSITarget{}, false
+	}
+
+	portal, groupTag, ipv6 := splitPortalGroupTag(fields[0])
+	return ISCSITarget{
+		Portal:   portal,
+		GroupTag: groupTag,
+		Target:   fields[1],
+		IPv6:     ipv6,
+	}, true
+}
+
+// splitPortalGroupTag splits "addrtag" of the form "<portal>,<groupTag>"
+// into its portal and group tag. An IPv6 portal is bracketed
+// ("[fe80::1]:3260,1"), so the group tag is found from the last comma
+// rather than the first.
+func splitPortalGroupTag(addrtag string) (portal, groupTag string, ipv6 bool) {
+	ipv6 = strings.HasPrefix(addrtag, "[")
+	idx := strings.LastIndex(addrtag, ",")
+	if idx < 0 {
+		return addrtag, "", ipv6
+	}
+	return addrtag[:idx], addrtag[idx+1:], ipv6
+}
+
 // GetInitiators returns a list of initiators on the local system.
 func (iscsi *LinuxISCSI) GetInitiators(filename string) ([]string, error) {
-	return iscsi.getInitiators(filename)
+	return iscsi.getInitiators(context.Background(), filename)
 }
 
-func (iscsi *LinuxISCSI) getInitiators(filename string) ([]string, error) {
+// GetInitiatorsContext is like GetInitiators but accepts a context.Context,
+// checked between files so a caller can cancel a request touching many
+// chrooted initiator files.
+func (iscsi *LinuxISCSI) GetInitiatorsContext(ctx context.Context, filename string) ([]string, error) {
+	return iscsi.getInitiators(ctx, filename)
+}
+
+func (iscsi *LinuxISCSI) getInitiators(ctx context.Context, filename string) ([]string, error) {
 
 	// a slice of filename, which might exist and define the iSCSI initiators
 	initiatorConfig := []string{}
@@ -123,26 +272,24 @@ func (iscsi *LinuxISCSI) getInitiators(filename string) ([]string, error) {
 
 	// for each initiatior config file
 	for _, init := range initiatorConfig {
-		// make sure the file exists
-		_, err := os.Stat(init)
-		if err != nil {
-			return []string{}, err
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
 
 		// get the contents of the initiator config file
-		cmd := exec.Command("cat", init)
-
-		out, err := cmd.Output()
+		data, err := os.ReadFile(init)
 		if err != nil {
-			fmt.Printf("Error gathering initiator names: %v", err)
+			iscsi.log().Printf("Error gathering initiator names: %v", err)
 			return nil, err
 		}
-		lines := strings.Split(string(out), "\n")
-		for _, l := range lines {
-			// remove all whitespace to catch different formatting
-			l = strings.Join(strings.Fields(l), "")
-			if strings.HasPrefix(l, "InitiatorName=") {
-				iqns = append(iqns, strings.Split(l, "=")[1])
+		for _, l := range strings.Split(string(data), "\n") {
+			// strip comments before matching, so "InitiatorName=foo # bar"
+			// and lines that are entirely commented out are both handled
+			if idx := strings.Index(l, "#"); idx >= 0 {
+				l = l[:idx]
+			}
+			if m := initiatorNameRegex.FindStringSubmatch(l); m != nil {
+				iqns = append(iqns, m[1])
 			}
 		}
 	}
@@ -152,39 +299,36 @@ func (iscsi *LinuxISCSI) getInitiators(filename string) ([]string, error) {
 
 // PerformLogin will attempt to log into an iSCSI target
 func (iscsi *LinuxISCSI) PerformLogin(target ISCSITarget) error {
-	return iscsi.performLogin(target)
+	return iscsi.performLoginContext(context.Background(), target)
 }
 
-func (iscsi *LinuxISCSI) performLogin(target ISCSITarget) error {
-	// iSCSI login is done via the iscsiadm cli
-	// iscsiadm -m node -T <target> --portal <address> -l
-	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "node", "-T", target.Target, "--portal", target.Portal, "-l"})
-	cmd := exec.Command(exe[0], exe[1:]...)
-
-	_, err := cmd.Output()
+// PerformLoginContext is like PerformLogin but accepts a context.Context so
+// callers can cancel a login that hangs against an unreachable portal.
+func (iscsi *LinuxISCSI) PerformLoginContext(ctx context.Context, target ISCSITarget) error {
+	return iscsi.performLoginContext(ctx, target)
+}
 
-	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			// iscsiadm exited with an exit code != 0
-			iscsiResult := -1
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				iscsiResult = status.ExitStatus()
-			}
-			if iscsiResult == 15 {
-				// session already exists
-				// do not treat this as a failure
-				err = nil
-			} else {
-				fmt.Printf("iscsiadm login failure: %v", err)
-			}
-		} else {
-			fmt.Printf("Error logging %s at %s: %v", target.Target, target.Portal, err)
+func (iscsi *LinuxISCSI) performLoginContext(ctx context.Context, target ISCSITarget) error {
+	if target.CHAP.HasSessionCHAP() {
+		if err := iscsi.runCHAPUpdatesContext(ctx, target.CHAP.sessionUpdateArgs(target.Target, target.Portal)); err != nil {
+			return err
 		}
+	}
 
-		if err != nil {
-			fmt.Printf("Error logging %s at %s: %v", target.Target, target.Portal, err)
-			return err
+	// iSCSI login is done via the iscsiadm cli
+	// iscsiadm -m node -T <target> --portal <address> [-I <iface>] -l
+	args := []string{"iscsiadm", "-m", "node", "-T", target.Target, "--portal", target.Portal}
+	if target.Iface != "" {
+		args = append(args, "-I", target.Iface)
+	}
+	args = append(args, "-l")
+	_, err := iscsi.runISCSIAdm(ctx, "login", target.Target, target.Portal, args)
+	if err != nil {
+		if errors.Is(err, ErrSessionExists) {
+			// session already exists; do not treat this as a failure
+			return nil
 		}
+		return err
 	}
 
 	return nil
@@ -192,55 +336,118 @@ func (iscsi *LinuxISCSI) performLogin(target ISCSITarget) error {
 
 // PerformLogout will attempt to log out of an iSCSI target
 func (iscsi *LinuxISCSI) PerformLogout(target ISCSITarget) error {
-	return iscsi.performLogout(target)
+	return iscsi.performLogoutContext(context.Background(), target)
 }
 
-func (iscsi *LinuxISCSI) performLogout(target ISCSITarget) error {
-	// iSCSI login is done via the iscsiadm cli
-	// iscsiadm -m node -T <target> --portal <address> -l
-	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "node", "-T", target.Target, "--portal", target.Portal, "--logout"})
-	cmd := exec.Command(exe[0], exe[1:]...)
+// PerformLogoutContext is like PerformLogout but accepts a
+// context.Context so callers can cancel a logout that hangs against an
+// unreachable portal.
+func (iscsi *LinuxISCSI) PerformLogoutContext(ctx context.Context, target ISCSITarget) error {
+	return iscsi.performLogoutContext(ctx, target)
+}
 
-	_, err := cmd.Output()
+func (iscsi *LinuxISCSI) performLogoutContext(ctx context.Context, target ISCSITarget) error {
+	// iSCSI logout is done via the iscsiadm cli
+	// iscsiadm -m node -T <target> --portal <address> [-I <iface>] --logout
+	args := []string{"iscsiadm", "-m", "node", "-T", target.Target, "--portal", target.Portal}
+	if target.Iface != "" {
+		args = append(args, "-I", target.Iface)
+	}
+	args = append(args, "--logout")
+	_, err := iscsi.runISCSIAdm(ctx, "logout", target.Target, target.Portal, args)
 	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			// iscsiadm exited with an exit code != 0
-			iscsiResult := -1
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				iscsiResult = status.ExitStatus()
-			}
-			if iscsiResult == 15 {
-				// session already exists
-				// do not treat this as a failure
-				err = nil
-			} else {
-				fmt.Printf("iscsiadm login failure: %v", err)
-			}
-		} else {
-			fmt.Printf("Error logging %s at %s: %v", target.Target, target.Portal, err)
+		if errors.Is(err, ErrNoObjectsFound) {
+			// no matching session to log out of; do not treat this as a failure
+			return nil
 		}
+		return err
+	}
 
-		if err != nil {
-			fmt.Printf("Error logging %s at %s: %v", target.Target, target.Portal, err)
-			return err
+	return nil
+}
+
+// GetSessions returns the structured list of currently logged-in iSCSI
+// sessions, parsed from `iscsiadm -m session -P 3`.
+func (iscsi *LinuxISCSI) GetSessions() ([]ISCSISession, error) {
+	return iscsi.getSessionsContext(context.Background())
+}
+
+// GetSessionsContext is like GetSessions but accepts a context.Context so
+// callers can cancel a request that hangs.
+func (iscsi *LinuxISCSI) GetSessionsContext(ctx context.Context) ([]ISCSISession, error) {
+	return iscsi.getSessionsContext(ctx)
+}
+
+func (iscsi *LinuxISCSI) getSessionsContext(ctx context.Context) ([]ISCSISession, error) {
+	out, err := iscsi.runISCSIAdm(ctx, "session-list", "", "", []string{"iscsiadm", "-m", "session", "-P", "3"})
+	if err != nil {
+		if errors.Is(err, ErrNoObjectsFound) {
+			// no sessions found
+			return []ISCSISession{}, nil
 		}
+		return []ISCSISession{}, err
 	}
 
-	return nil
+	return parseSessionSummaryOutput(string(out)), nil
 }
 
-// PerformRescan will will rescan targets known to current sessions
-func (iscsi *LinuxISCSI) PerformRescan() error {
-	return iscsi.performRescan()
+// GetSessionForTarget returns the session logged into iqn at portal, or nil
+// if there isn't one.
+func (iscsi *LinuxISCSI) GetSessionForTarget(iqn, portal string) (*ISCSISession, error) {
+	return iscsi.getSessionForTargetContext(context.Background(), iqn, portal)
 }
 
-func (iscsi *LinuxISCSI) performRescan() error {
-	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "node", "--rescan"})
-	cmd := exec.Command(exe[0], exe[1:]...)
+// GetSessionForTargetContext is like GetSessionForTarget but accepts a
+// context.Context so callers can cancel a request that hangs.
+func (iscsi *LinuxISCSI) GetSessionForTargetContext(ctx context.Context, iqn, portal string) (*ISCSISession, error) {
+	return iscsi.getSessionForTargetContext(ctx, iqn, portal)
+}
 
-	_, err := cmd.Output()
+func (iscsi *LinuxISCSI) getSessionForTargetContext(ctx context.Context, iqn, portal string) (*ISCSISession, error) {
+	sessions, err := iscsi.getSessionsContext(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
-}
\ No newline at end of file
+	return findSession(sessions, iqn, portal), nil
+}
+
+// NodeExists returns whether iqn at portal has a node record in the local
+// iscsiadm node database, regardless of whether it currently has a session.
+func (iscsi *LinuxISCSI) NodeExists(iqn, portal string) (bool, error) {
+	return iscsi.nodeExistsContext(context.Background(), iqn, portal)
+}
+
+// NodeExistsContext is like NodeExists but accepts a context.Context so
+// callers can cancel a request that hangs.
+func (iscsi *LinuxISCSI) NodeExistsContext(ctx context.Context, iqn, portal string) (bool, error) {
+	return iscsi.nodeExistsContext(ctx, iqn, portal)
+}
+
+func (iscsi *LinuxISCSI) nodeExistsContext(ctx context.Context, iqn, portal string) (bool, error) {
+	_, err := iscsi.runISCSIAdm(ctx, "node-exists", iqn, portal, []string{"iscsiadm", "-m", "node", "-T", iqn, "-p", portal})
+	if err != nil {
+		if errors.Is(err, ErrNoObjectsFound) {
+			// no records found
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PerformRescan will will rescan targets known to current sessions
+func (iscsi *LinuxISCSI) PerformRescan() error {
+	return iscsi.performRescanContext(context.Background())
+}
+
+// PerformRescanContext is like PerformRescan but accepts a context.Context
+// so callers can cancel a rescan that hangs.
+func (iscsi *LinuxISCSI) PerformRescanContext(ctx context.Context) error {
+	return iscsi.performRescanContext(ctx)
+}
+
+func (iscsi *LinuxISCSI) performRescanContext(ctx context.Context) error {
+	_, err := iscsi.runISCSIAdm(ctx, "rescan", "", "", []string{"iscsiadm", "-m", "node", "--rescan"})
+	return err
+}
@@ -0,0 +1,165 @@
+package goiscsi
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitPortalGroupTag(t *testing.T) {
+	tests := []struct {
+		name         string
+		addrtag      string
+		wantPortal   string
+		wantGroupTag string
+		wantIPv6     bool
+	}{
+		{
+			name:         "ipv4 with group tag",
+			addrtag:      "10.247.73.130:3260,0",
+			wantPortal:   "10.247.73.130:3260",
+			wantGroupTag: "0",
+		},
+		{
+			name:         "ipv6 with group tag",
+			addrtag:      "[fe80::1]:3260,1",
+			wantPortal:   "[fe80::1]:3260",
+			wantGroupTag: "1",
+			wantIPv6:     true,
+		},
+		{
+			name:       "no group tag",
+			addrtag:    "10.247.73.130:3260",
+			wantPortal: "10.247.73.130:3260",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portal, groupTag, ipv6 := splitPortalGroupTag(tt.addrtag)
+			if portal != tt.wantPortal || groupTag != tt.wantGroupTag || ipv6 != tt.wantIPv6 {
+				t.Errorf("splitPortalGroupTag(%q) = (%q, %q, %v), want (%q, %q, %v)",
+					tt.addrtag, portal, groupTag, ipv6, tt.wantPortal, tt.wantGroupTag, tt.wantIPv6)
+			}
+		})
+	}
+}
+
+func TestParseDiscoveryLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		want   ISCSITarget
+		wantOk bool
+	}{
+		{
+			name: "ipv4",
+			line: "10.247.73.130:3260,0 iqn.1992-04.com.emc:600009700bcbb70e3287017400000001",
+			want: ISCSITarget{
+				Portal:   "10.247.73.130:3260",
+				GroupTag: "0",
+				Target:   "iqn.1992-04.com.emc:600009700bcbb70e3287017400000001",
+			},
+			wantOk: true,
+		},
+		{
+			name: "ipv6 bracketed portal",
+			line: "[fe80::1]:3260,1 iqn.1992-04.com.emc:600009700bcbb70e3287017400000001",
+			want: ISCSITarget{
+				Portal:   "[fe80::1]:3260",
+				GroupTag: "1",
+				Target:   "iqn.1992-04.com.emc:600009700bcbb70e3287017400000001",
+				IPv6:     true,
+			},
+			wantOk: true,
+		},
+		{
+			name: "extra whitespace between fields",
+			line: "10.247.73.130:3260,0    iqn.1992-04.com.emc:600009700bcbb70e3287017400000001",
+			want: ISCSITarget{
+				Portal:   "10.247.73.130:3260",
+				GroupTag: "0",
+				Target:   "iqn.1992-04.com.emc:600009700bcbb70e3287017400000001",
+			},
+			wantOk: true,
+		},
+		{
+			name:   "empty line",
+			line:   "",
+			wantOk: false,
+		},
+		{
+			name:   "too few fields",
+			line:   "10.247.73.130:3260,0",
+			wantOk: false,
+		},
+		{
+			name:   "too many fields",
+			line:   "10.247.73.130:3260,0 iqn.1992-04.com.emc:foo extra",
+			wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseDiscoveryLine(tt.line)
+			if ok != tt.wantOk {
+				t.Fatalf("parseDiscoveryLine(%q) ok = %v, want %v", tt.line, ok, tt.wantOk)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDiscoveryLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinuxISCSI_GetInitiators(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "initiatorname.iscsi")
+	contents := "## DO NOT EDIT OR REMOVE THIS FILE!\n" +
+		"# If you remove this file, the iSCSI daemon will not start.\n" +
+		"\n" +
+		"InitiatorName=iqn.1994-05.com.redhat:client1 # primary\n" +
+		"\n" +
+		"   InitiatorName=iqn.1994-05.com.redhat:client2\n" +
+		"not an initiator line\n"
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	iscsi := NewLinuxISCSI(nil)
+	got, err := iscsi.GetInitiators(path)
+	if err != nil {
+		t.Fatalf("GetInitiators() error = %v", err)
+	}
+
+	want := []string{"iqn.1994-05.com.redhat:client1", "iqn.1994-05.com.redhat:client2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetInitiators() = %v, want %v", got, want)
+	}
+}
+
+func TestLinuxISCSI_GetInitiators_MissingFile(t *testing.T) {
+	iscsi := NewLinuxISCSI(nil)
+	if _, err := iscsi.GetInitiators(filepath.Join(t.TempDir(), "does-not-exist")); err == nil {
+		t.Fatal("expected an error for a missing initiator config file")
+	}
+}
+
+func TestLinuxISCSI_GetInitiatorsContext_CancelledBeforeRead(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "initiatorname.iscsi")
+	if err := os.WriteFile(path, []byte("InitiatorName=iqn.1994-05.com.redhat:client1\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	iscsi := NewLinuxISCSI(nil)
+	if _, err := iscsi.GetInitiatorsContext(ctx, path); err != context.Canceled {
+		t.Fatalf("GetInitiatorsContext() error = %v, want context.Canceled", err)
+	}
+}
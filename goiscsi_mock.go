@@ -1,6 +1,7 @@
 package goiscsi
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
@@ -17,17 +18,27 @@ const (
 var (
 	// GOISCSIMock is a struct controlling induced errors
 	GOISCSIMock struct {
-		InduceDiscoveryError bool
-		InduceInitiatorError bool
-		InduceLoginError     bool
-		InduceLogoutError    bool
-		InduceRescanError    bool
+		InduceDiscoveryError   bool
+		InduceInitiatorError   bool
+		InduceLoginError       bool
+		InduceLogoutError      bool
+		InduceRescanError      bool
+		InduceGetSessionsError bool
+		InduceNodeExistsError  bool
 	}
 )
 
 // MockISCSI provides a mock implementation of an iscsi client
 type MockISCSI struct {
 	ISCSIType
+
+	// Sessions is the canned result returned by GetSessions, so tests can
+	// exercise session-listing consumers without a live initiator.
+	Sessions []ISCSISession
+
+	// Ifaces tracks the ifaces created via CreateIface, keyed by name, so
+	// tests can exercise iface binding without a live initiator.
+	Ifaces map[string]Iface
 }
 
 // NewMockISCSI returns an mock ISCSI client
@@ -49,9 +60,18 @@ func getOptionAsInt(opts map[string]string, key string) int64 {
 }
 
 func (iscsi *MockISCSI) discoverTargets(address string, login bool) ([]ISCSITarget, error) {
+	return iscsi.discoverTargetsWithCHAP(address, login, nil)
+}
+
+func (iscsi *MockISCSI) discoverTargetsWithCHAP(address string, login bool, chap *CHAPCredentials) ([]ISCSITarget, error) {
 	if GOISCSIMock.InduceDiscoveryError {
 		return []ISCSITarget{}, errors.New("discoverTargets induced error")
 	}
+
+	if chap != nil && !chap.HasDiscoveryCHAP() {
+		return []ISCSITarget{}, errors.New("incomplete discovery CHAP credentials")
+	}
+
 	mockedTargets := make([]ISCSITarget, 0)
 	count := getOptionAsInt(iscsi.options, MockNumberOfTargets)
 	if count == 0 {
@@ -65,9 +85,19 @@ func (iscsi *MockISCSI) discoverTargets(address string, login bool) ([]ISCSITarg
 				Portal:   address + ":3260",
 				GroupTag: "0",
 				Target:   "iqn.1992-04.com.mock:600009700bcbb70e32870174000" + tgt,
+				CHAP:     chap,
 			})
 	}
 
+	// log into the target if asked
+	if login {
+		for _, t := range mockedTargets {
+			if err := iscsi.performLogin(t); err != nil {
+				return []ISCSITarget{}, err
+			}
+		}
+	}
+
 	// send back a slice of targets
 	return mockedTargets, nil
 }
@@ -98,6 +128,16 @@ func (iscsi *MockISCSI) performLogin(target ISCSITarget) error {
 		return errors.New("iSCSI Login induced error")
 	}
 
+	if target.CHAP != nil && !target.CHAP.HasSessionCHAP() {
+		return errors.New("incomplete session CHAP credentials")
+	}
+
+	if target.Iface != "" {
+		if _, ok := iscsi.Ifaces[target.Iface]; !ok {
+			return fmt.Errorf("iface %q does not exist", target.Iface)
+		}
+	}
+
 	return nil
 }
 
@@ -110,6 +150,76 @@ func (iscsi *MockISCSI) performLogout(target ISCSITarget) error {
 	return nil
 }
 
+// GetSessions returns the canned Sessions slice.
+func (iscsi *MockISCSI) GetSessions() ([]ISCSISession, error) {
+	if GOISCSIMock.InduceGetSessionsError {
+		return []ISCSISession{}, errors.New("getSessions induced error")
+	}
+	return iscsi.Sessions, nil
+}
+
+// GetSessionForTarget returns the session logged into iqn at portal, or nil
+// if there isn't one, from the canned Sessions slice.
+func (iscsi *MockISCSI) GetSessionForTarget(iqn, portal string) (*ISCSISession, error) {
+	sessions, err := iscsi.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return findSession(sessions, iqn, portal), nil
+}
+
+// NodeExists reports whether iqn at portal appears as a session in the
+// canned Sessions slice.
+func (iscsi *MockISCSI) NodeExists(iqn, portal string) (bool, error) {
+	if GOISCSIMock.InduceNodeExistsError {
+		return false, errors.New("nodeExists induced error")
+	}
+	return findSession(iscsi.Sessions, iqn, portal) != nil, nil
+}
+
+// CreateIface records an iface named name with the given params so that
+// subsequent logins may reference it.
+func (iscsi *MockISCSI) CreateIface(name string, params IfaceParams) error {
+	if iscsi.Ifaces == nil {
+		iscsi.Ifaces = make(map[string]Iface)
+	}
+	iscsi.Ifaces[name] = Iface{
+		Name:          name,
+		Transport:     "tcp",
+		HWAddress:     params.HWAddress,
+		IPAddress:     params.IPAddress,
+		NetIfaceName:  params.NetIfaceName,
+		InitiatorName: params.InitiatorName,
+	}
+	return nil
+}
+
+// DeleteIface removes the iface named name.
+func (iscsi *MockISCSI) DeleteIface(name string) error {
+	delete(iscsi.Ifaces, name)
+	return nil
+}
+
+// ListIfaces returns the ifaces created via CreateIface.
+func (iscsi *MockISCSI) ListIfaces() ([]Iface, error) {
+	ifaces := make([]Iface, 0, len(iscsi.Ifaces))
+	for _, iface := range iscsi.Ifaces {
+		ifaces = append(ifaces, iface)
+	}
+	return ifaces, nil
+}
+
+// UpdateIfaceInitiatorName sets the initiator name recorded for iface.
+func (iscsi *MockISCSI) UpdateIfaceInitiatorName(iface, initiatorName string) error {
+	rec, ok := iscsi.Ifaces[iface]
+	if !ok {
+		return fmt.Errorf("iface %q does not exist", iface)
+	}
+	rec.InitiatorName = initiatorName
+	iscsi.Ifaces[iface] = rec
+	return nil
+}
+
 func (iscsi *MockISCSI) performRescan() error {
 
 	if GOISCSIMock.InduceRescanError {
@@ -124,7 +234,14 @@ func (iscsi *MockISCSI) performRescan() error {
 
 // DiscoverTargets runs an iSCSI discovery and returns a list of targets.
 func (iscsi *MockISCSI) DiscoverTargets(address string, login bool) ([]ISCSITarget, error) {
-	return iscsi.discoverTargets(address, login)
+	return iscsi.discoverTargetsWithCHAP(address, login, nil)
+}
+
+// DiscoverTargetsWithCHAP runs an iSCSI discovery against address, first
+// validating the discovery-phase CHAP secrets in chap (if any), and
+// returns the list of discovered targets.
+func (iscsi *MockISCSI) DiscoverTargetsWithCHAP(address string, login bool, chap *CHAPCredentials) ([]ISCSITarget, error) {
+	return iscsi.discoverTargetsWithCHAP(address, login, chap)
 }
 
 // GetInitiators returns a list of initiators on the local system.
@@ -137,11 +254,29 @@ func (iscsi *MockISCSI) PerformLogin(target ISCSITarget) error {
 	return iscsi.performLogin(target)
 }
 
+// PerformLoginContext is like PerformLogin but accepts a context.Context,
+// honored by returning ctx.Err() if it's already done.
+func (iscsi *MockISCSI) PerformLoginContext(ctx context.Context, target ISCSITarget) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return iscsi.performLogin(target)
+}
+
 // PerformLogout will attempt to log out of an iSCSI target
 func (iscsi *MockISCSI) PerformLogout(target ISCSITarget) error {
 	return iscsi.performLogout(target)
 }
 
+// PerformLogoutContext is like PerformLogout but accepts a context.Context,
+// honored by returning ctx.Err() if it's already done.
+func (iscsi *MockISCSI) PerformLogoutContext(ctx context.Context, target ISCSITarget) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return iscsi.performLogout(target)
+}
+
 // PerformRescan will will rescan targets known to current sessions
 func (iscsi *MockISCSI) PerformRescan() error {
 	return iscsi.performRescan()
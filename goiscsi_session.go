@@ -0,0 +1,129 @@
+package goiscsi
+
+import (
+	"bufio"
+	"strings"
+)
+
+// ISCSISessionDevice is one SCSI device attached to an ISCSISession, as
+// reported under "Attached SCSI devices" by `iscsiadm -m session -P 3`.
+type ISCSISessionDevice struct {
+	Device string
+	Lun    string
+	State  string
+}
+
+// ISCSISession is a structured view of one iSCSI session, parsed from
+// `iscsiadm -m session -P 3` output.
+type ISCSISession struct {
+	SID                   string
+	Target                string
+	PersistentPortal      string
+	CurrentPortal         string
+	IfaceName             string
+	IfaceIPaddress        string
+	IfaceHWaddress        string
+	HeaderDigest          string
+	DataDigest            string
+	MaxRecvDataSegmentLen string
+	Devices               []ISCSISessionDevice
+}
+
+// parseSessionSummaryOutput parses the output of `iscsiadm -m session -P 3`
+// into structured records.
+func parseSessionSummaryOutput(out string) []ISCSISession {
+	sessions := make([]ISCSISession, 0)
+
+	var cur *ISCSISession
+	var device *ISCSISessionDevice
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "Target:"):
+			sessions = append(sessions, ISCSISession{Target: sessionFieldValue(line, "Target:")})
+			cur = &sessions[len(sessions)-1]
+			device = nil
+		case cur == nil:
+			// lines before the first "Target:" aren't part of any session
+			continue
+		case strings.HasPrefix(line, "Current Portal:"):
+			cur.CurrentPortal = sessionPortalValue(line, "Current Portal:")
+		case strings.HasPrefix(line, "Persistent Portal:"):
+			cur.PersistentPortal = sessionPortalValue(line, "Persistent Portal:")
+		case strings.HasPrefix(line, "Iface Name:"):
+			cur.IfaceName = sessionFieldValue(line, "Iface Name:")
+		case strings.HasPrefix(line, "Iface IPaddress:"):
+			cur.IfaceIPaddress = sessionFieldValue(line, "Iface IPaddress:")
+		case strings.HasPrefix(line, "Iface HWaddress:"):
+			cur.IfaceHWaddress = sessionFieldValue(line, "Iface HWaddress:")
+		case strings.HasPrefix(line, "SID:"):
+			cur.SID = sessionFieldValue(line, "SID:")
+		case strings.HasPrefix(line, "HeaderDigest:"):
+			cur.HeaderDigest = sessionFieldValue(line, "HeaderDigest:")
+		case strings.HasPrefix(line, "DataDigest:"):
+			cur.DataDigest = sessionFieldValue(line, "DataDigest:")
+		case strings.HasPrefix(line, "MaxRecvDataSegmentLength:"):
+			cur.MaxRecvDataSegmentLen = sessionFieldValue(line, "MaxRecvDataSegmentLength:")
+		case strings.HasPrefix(line, "scsi") && strings.Contains(line, "Lun:"):
+			cur.Devices = append(cur.Devices, ISCSISessionDevice{})
+			device = &cur.Devices[len(cur.Devices)-1]
+			device.Lun = firstToken(line[strings.Index(line, "Lun:")+len("Lun:"):])
+		case strings.HasPrefix(line, "Attached scsi disk") && device != nil:
+			fields := strings.Fields(line)
+			// Attached scsi disk sdb		State: running
+			if len(fields) >= 4 {
+				device.Device = fields[3]
+			}
+			if idx := strings.Index(line, "State:"); idx >= 0 {
+				device.State = sessionFieldValue(line[idx:], "State:")
+			}
+		}
+	}
+
+	return sessions
+}
+
+// sessionFieldValue returns the trimmed text of line following prefix.
+func sessionFieldValue(line, prefix string) string {
+	return strings.TrimSpace(strings.TrimPrefix(line, prefix))
+}
+
+// sessionPortalValue returns the portal in line following prefix, with the
+// trailing ",<tpgt>" group tag stripped so it is comparable with the
+// "<ip>:<port>" portal form produced by parseDiscoveryLine and used
+// throughout the rest of this package (ConnectRequest.Portals,
+// connectionRecord.Portals, ISCSITarget.Portal).
+func sessionPortalValue(line, prefix string) string {
+	portal, _, _ := splitPortalGroupTag(firstToken(sessionFieldValue(line, prefix)))
+	return portal
+}
+
+// firstToken returns the first whitespace-separated token of s.
+func firstToken(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// findSession returns the session in sessions matching iqn and portal
+// (checked against both the current and persistent portal), or nil.
+func findSession(sessions []ISCSISession, iqn, portal string) *ISCSISession {
+	for i := range sessions {
+		s := &sessions[i]
+		if s.Target != iqn {
+			continue
+		}
+		if portal == "" || s.CurrentPortal == portal || s.PersistentPortal == portal {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package goiscsi
+
+import (
+	"reflect"
+	"testing"
+)
+
+const sampleSessionSummary = `
+Target: iqn.1992-04.com.example:storage.target01
+	Current Portal: 10.0.0.1:3260,1
+	Persistent Portal: 10.0.0.1:3260,1
+		**********
+		Interface:
+		**********
+		Iface Name: default
+		Iface Transport: tcp
+		Iface Initiatorname: iqn.1994-05.com.redhat:client
+		Iface IPaddress: 10.0.0.5
+		Iface HWaddress: <empty>
+		Iface Netdev: <empty>
+		SID: 1
+		iSCSI Connection State: LOGGED IN
+		iSCSI Session State: LOGGED_IN
+		************************
+		Negotiated iSCSI params:
+		************************
+		HeaderDigest: None
+		DataDigest: None
+		MaxRecvDataSegmentLength: 262144
+		************************
+		Attached SCSI devices:
+		************************
+		Host Number: 4	State: running
+		scsi4 Channel 00 Id 0 Lun: 0
+			Attached scsi disk sdb		State: running
+Target: iqn.1992-04.com.example:storage.target02
+	Current Portal: 10.0.0.2:3260,1
+	Persistent Portal: 10.0.0.2:3260,1
+		**********
+		Interface:
+		**********
+		Iface Name: eth1
+		Iface Transport: tcp
+		Iface Initiatorname: iqn.1994-05.com.redhat:client
+		Iface IPaddress: 10.0.0.6
+		Iface HWaddress: <empty>
+		Iface Netdev: <empty>
+		SID: 2
+		iSCSI Connection State: LOGGED IN
+		iSCSI Session State: LOGGED_IN
+		************************
+		Negotiated iSCSI params:
+		************************
+		HeaderDigest: None
+		DataDigest: None
+		MaxRecvDataSegmentLength: 131072
+		************************
+		Attached SCSI devices:
+		************************
+		Host Number: 5	State: running
+		scsi5 Channel 00 Id 0 Lun: 1
+			Attached scsi disk sdc		State: running
+`
+
+func TestParseSessionSummaryOutput(t *testing.T) {
+	sessions := parseSessionSummaryOutput(sampleSessionSummary)
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(sessions))
+	}
+
+	want0 := ISCSISession{
+		SID:                   "1",
+		Target:                "iqn.1992-04.com.example:storage.target01",
+		PersistentPortal:      "10.0.0.1:3260",
+		CurrentPortal:         "10.0.0.1:3260",
+		IfaceName:             "default",
+		IfaceIPaddress:        "10.0.0.5",
+		IfaceHWaddress:        "<empty>",
+		HeaderDigest:          "None",
+		DataDigest:            "None",
+		MaxRecvDataSegmentLen: "262144",
+		Devices: []ISCSISessionDevice{
+			{Device: "sdb", Lun: "0", State: "running"},
+		},
+	}
+	if !reflect.DeepEqual(sessions[0], want0) {
+		t.Errorf("sessions[0] = %+v, want %+v", sessions[0], want0)
+	}
+
+	want1 := ISCSISession{
+		SID:                   "2",
+		Target:                "iqn.1992-04.com.example:storage.target02",
+		PersistentPortal:      "10.0.0.2:3260",
+		CurrentPortal:         "10.0.0.2:3260",
+		IfaceName:             "eth1",
+		IfaceIPaddress:        "10.0.0.6",
+		IfaceHWaddress:        "<empty>",
+		HeaderDigest:          "None",
+		DataDigest:            "None",
+		MaxRecvDataSegmentLen: "131072",
+		Devices: []ISCSISessionDevice{
+			{Device: "sdc", Lun: "1", State: "running"},
+		},
+	}
+	if !reflect.DeepEqual(sessions[1], want1) {
+		t.Errorf("sessions[1] = %+v, want %+v", sessions[1], want1)
+	}
+}
+
+func TestParseSessionSummaryOutput_Empty(t *testing.T) {
+	sessions := parseSessionSummaryOutput("iscsiadm: No active sessions.\n")
+	if len(sessions) != 0 {
+		t.Errorf("got %d sessions, want 0", len(sessions))
+	}
+}
+
+func TestFindSession(t *testing.T) {
+	sessions := parseSessionSummaryOutput(sampleSessionSummary)
+
+	if s := findSession(sessions, "iqn.1992-04.com.example:storage.target02", "10.0.0.2:3260"); s == nil {
+		t.Fatal("expected to find session for target02")
+	} else if s.SID != "2" {
+		t.Errorf("found session SID = %q, want 2", s.SID)
+	}
+
+	if s := findSession(sessions, "iqn.1992-04.com.example:storage.target01", "10.0.0.9:3260"); s != nil {
+		t.Errorf("expected no session for mismatched portal, got %+v", s)
+	}
+
+	if s := findSession(sessions, "iqn.1992-04.com.example:storage.target01", ""); s == nil {
+		t.Error("expected a match when portal is empty")
+	}
+}
+
+// TestFindSession_DiscoveryPortalForm verifies findSession matches a portal
+// in the tag-less "<ip>:<port>" form that parseDiscoveryLine produces (and
+// that ConnectRequest/connectionRecord carry), not just the raw
+// "<ip>:<port>,<tpgt>" form iscsiadm reports in session output.
+func TestFindSession_DiscoveryPortalForm(t *testing.T) {
+	sessions := parseSessionSummaryOutput(sampleSessionSummary)
+
+	target, ok := parseDiscoveryLine("10.0.0.1:3260,1 iqn.1992-04.com.example:storage.target01")
+	if !ok {
+		t.Fatal("parseDiscoveryLine() failed to parse sample line")
+	}
+
+	s := findSession(sessions, target.Target, target.Portal)
+	if s == nil || s.SID != "1" {
+		t.Errorf("findSession() with discovery-form portal %q = %+v, want SID 1", target.Portal, s)
+	}
+}
+
+func TestMockISCSI_GetSessions(t *testing.T) {
+	iscsi := NewMockISCSI(nil)
+	iscsi.Sessions = parseSessionSummaryOutput(sampleSessionSummary)
+
+	got, err := iscsi.GetSessions()
+	if err != nil {
+		t.Fatalf("GetSessions() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("GetSessions() returned %d sessions, want 2", len(got))
+	}
+
+	GOISCSIMock.InduceGetSessionsError = true
+	defer func() { GOISCSIMock.InduceGetSessionsError = false }()
+	if _, err := iscsi.GetSessions(); err == nil {
+		t.Error("expected induced GetSessions error")
+	}
+}
+
+func TestMockISCSI_GetSessionForTarget(t *testing.T) {
+	iscsi := NewMockISCSI(nil)
+	iscsi.Sessions = parseSessionSummaryOutput(sampleSessionSummary)
+
+	s, err := iscsi.GetSessionForTarget("iqn.1992-04.com.example:storage.target01", "10.0.0.1:3260")
+	if err != nil {
+		t.Fatalf("GetSessionForTarget() error = %v", err)
+	}
+	if s == nil || s.SID != "1" {
+		t.Errorf("GetSessionForTarget() = %+v, want SID 1", s)
+	}
+
+	s, err = iscsi.GetSessionForTarget("iqn.1992-04.com.example:unknown", "10.0.0.1:3260")
+	if err != nil {
+		t.Fatalf("GetSessionForTarget() error = %v", err)
+	}
+	if s != nil {
+		t.Errorf("GetSessionForTarget() for unknown target = %+v, want nil", s)
+	}
+}
+
+func TestMockISCSI_NodeExists(t *testing.T) {
+	iscsi := NewMockISCSI(nil)
+	iscsi.Sessions = parseSessionSummaryOutput(sampleSessionSummary)
+
+	exists, err := iscsi.NodeExists("iqn.1992-04.com.example:storage.target01", "10.0.0.1:3260")
+	if err != nil {
+		t.Fatalf("NodeExists() error = %v", err)
+	}
+	if !exists {
+		t.Error("NodeExists() = false, want true")
+	}
+
+	exists, err = iscsi.NodeExists("iqn.1992-04.com.example:unknown", "10.0.0.1:3260")
+	if err != nil {
+		t.Fatalf("NodeExists() error = %v", err)
+	}
+	if exists {
+		t.Error("NodeExists() for unknown target = true, want false")
+	}
+
+	GOISCSIMock.InduceNodeExistsError = true
+	defer func() { GOISCSIMock.InduceNodeExistsError = false }()
+	if _, err := iscsi.NodeExists("iqn.1992-04.com.example:storage.target01", "10.0.0.1:3260"); err == nil {
+		t.Error("expected induced NodeExists error")
+	}
+}